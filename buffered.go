@@ -0,0 +1,152 @@
+package link
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// ringPipe is a bounded byte ring buffer that supports a concurrent
+// reader and writer, in the spirit of the pipe buffer used by
+// golang.org/x/net/http2: a mutex and condition variables guarding a
+// fixed-size []byte ring. It lets BufferedOneWayLink decouple its
+// reader and writer goroutines so a slow writer no longer stalls the
+// reader directly.
+type ringPipe struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	buf      []byte
+	r, w     int
+	n        int // bytes currently buffered
+	err      error
+}
+
+func newRingPipe(capacity int) *ringPipe {
+	p := &ringPipe{buf: make([]byte, capacity)}
+	p.notEmpty = sync.NewCond(&p.mu)
+	p.notFull = sync.NewCond(&p.mu)
+	return p
+}
+
+// Read blocks until at least one byte is buffered or the pipe is
+// closed. Buffered bytes are returned even after close; once the pipe
+// is closed and empty, Read returns the error passed to CloseWithError
+// (io.EOF if that was nil).
+func (p *ringPipe) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.n == 0 && p.err == nil {
+		p.notEmpty.Wait()
+	}
+	if p.n == 0 {
+		return 0, p.err
+	}
+	rn := len(b)
+	if rn > p.n {
+		rn = p.n
+	}
+	first := len(p.buf) - p.r
+	if first > rn {
+		first = rn
+	}
+	copy(b[:first], p.buf[p.r:p.r+first])
+	if rn > first {
+		copy(b[first:rn], p.buf[:rn-first])
+	}
+	p.r = (p.r + rn) % len(p.buf)
+	p.n -= rn
+	p.notFull.Signal()
+	return rn, nil
+}
+
+// Write blocks until all of b has been copied into the ring, which
+// may require waiting for the reader to drain it. It returns early
+// with CloseWithError's error once the pipe has been closed.
+func (p *ringPipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	written := 0
+	for len(b) > 0 {
+		for p.n == len(p.buf) && p.err == nil {
+			p.notFull.Wait()
+		}
+		if p.err != nil {
+			return written, p.err
+		}
+		space := len(p.buf) - p.n
+		wn := len(b)
+		if wn > space {
+			wn = space
+		}
+		first := len(p.buf) - p.w
+		if first > wn {
+			first = wn
+		}
+		copy(p.buf[p.w:p.w+first], b[:first])
+		if wn > first {
+			copy(p.buf[:wn-first], b[first:wn])
+		}
+		p.w = (p.w + wn) % len(p.buf)
+		p.n += wn
+		written += wn
+		b = b[wn:]
+		p.notEmpty.Signal()
+	}
+	return written, nil
+}
+
+// CloseWithError unblocks any pending or future Read/Write with err,
+// so that once either side of the link fails the other side stops
+// promptly instead of blocking on a buffer nobody will drain or fill.
+// Only the first call takes effect.
+func (p *ringPipe) CloseWithError(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+		p.notEmpty.Broadcast()
+		p.notFull.Broadcast()
+	}
+}
+
+// BufferedOneWayLink is like OneWayLinkSpec, but runs the read side
+// (src -> cb) and the write side (-> dst) in separate goroutines
+// connected by an internal ring buffer of the given capacity, rather
+// than calling dst.Write synchronously after every src.Read. This
+// trades memory for throughput: a burst from src can be absorbed into
+// the buffer instead of stalling src.Read while dst.Write is slow,
+// which matters most on high-latency links. cb, if set, runs on the
+// reader side as each chunk comes off src.
+func BufferedOneWayLink(ctx context.Context, src io.Reader, dst io.Writer, capacity int, cb callbackFunc) (written int64, err error) {
+	if capacity <= 0 {
+		capacity = defaultBufferSize
+	}
+	pipe := newRingPipe(capacity)
+
+	readCtx, cancelRead := context.WithCancel(ctx)
+	defer cancelRead()
+
+	readDone := make(chan error, 1)
+	go func() {
+		_, rerr := OneWayLinkSpec(readCtx, src, pipe, nil, cb)
+		pipe.CloseWithError(rerr)
+		readDone <- rerr
+	}()
+
+	written, err = OneWayLinkSpec(ctx, pipe, dst, nil, nil)
+	if err != nil {
+		// Unblock the reader goroutine: it may be parked in
+		// pipe.Write with a full ring nobody will ever drain now, or
+		// in a blocked src.Read with nobody left to consume from it.
+		pipe.CloseWithError(err)
+		cancelRead()
+	}
+	if rerr := <-readDone; err == nil && rerr != nil {
+		err = rerr
+	}
+	return written, err
+}
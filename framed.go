@@ -0,0 +1,95 @@
+package link
+
+import (
+	"context"
+	"io"
+)
+
+// Framer splits a stream into discrete frames, with the same
+// semantics as bufio.SplitFunc: given the unconsumed data buffered so
+// far and whether src has reached EOF, Split returns how many bytes to
+// advance past (consuming them), the frame extracted from those bytes
+// (or nil if none is ready yet), and any error that should abort the
+// link. An advance of 0 with a nil frame and nil error means more data
+// is needed before a frame can be produced.
+type Framer interface {
+	Split(data []byte, atEOF bool) (advance int, frame []byte, err error)
+}
+
+// FramerFunc adapts a plain function to a Framer.
+type FramerFunc func(data []byte, atEOF bool) (advance int, frame []byte, err error)
+
+// Split calls f.
+func (f FramerFunc) Split(data []byte, atEOF bool) (int, []byte, error) {
+	return f(data, atEOF)
+}
+
+// OneWayLinkFramed is like OneWayLinkSpec, but instead of handing cb
+// whatever slice happened to come out of one src.Read, it buffers
+// reads and uses framer to carve out complete frames (length-prefixed,
+// line-delimited, TLS-record-sized, ...), invoking cb once per frame
+// and writing the (possibly rewritten) frame to dst. This is what
+// makes it safe to rewrite SNI in a TLS ClientHello, mangle HTTP/1
+// headers, or transform WebSocket frames, none of which tolerate
+// arbitrary chunk boundaries.
+func OneWayLinkFramed(ctx context.Context, src io.Reader, dst io.Writer, framer Framer, cb callbackFunc) (written int64, err error) {
+	stop := watchInterrupt(ctx, src)
+	defer stop()
+
+	var buf []byte
+	scratch := make([]byte, defaultBufferSize)
+	atEOF := false
+
+	for {
+		for {
+			advance, frame, ferr := framer.Split(buf, atEOF)
+			if ferr != nil {
+				return written, ferr
+			}
+			if advance == 0 {
+				break
+			}
+			if frame != nil {
+				out := frame
+				if cb != nil {
+					out = cb(out)
+				}
+				wn, ew := dst.Write(out)
+				written += int64(wn)
+				if ew != nil {
+					return written, ew
+				}
+				if wn != len(out) {
+					return written, io.ErrShortWrite
+				}
+			}
+			buf = buf[advance:]
+		}
+		if atEOF {
+			return written, nil
+		}
+		if ctx != nil {
+			select {
+			case <-ctx.Done():
+				return written, ctx.Err()
+			default:
+			}
+		}
+		n, er := src.Read(scratch)
+		if n > 0 {
+			buf = append(buf, scratch[:n]...)
+		}
+		if er != nil {
+			if er != io.EOF {
+				if ctx != nil && ctx.Err() != nil {
+					// er is most likely the side effect of
+					// watchInterrupt aborting this Read (a timeout
+					// or closed-pipe error), not the real failure.
+					return written, ctx.Err()
+				}
+				return written, er
+			}
+			atEOF = true
+		}
+	}
+}
@@ -3,6 +3,7 @@ package link
 import (
 	"context"
 	"io"
+	"time"
 )
 
 const (
@@ -11,6 +12,59 @@ const (
 
 type callbackFunc func([]byte) []byte
 
+// aLongTimeAgo is used to force an immediate timeout on sources that
+// support SetReadDeadline but have no dedicated cancellation hook.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// Interruptible may be implemented by a src passed to OneWayLinkSpec
+// (or OneWayLinkWithOptions) to define custom cancellation behavior
+// for when ctx is done. It takes priority over SetReadDeadline and
+// Close. A src that has SetReadDeadline (such as *os.File) is never
+// closed on cancellation, even if SetReadDeadline returns an error, so
+// Interruptible is the only option where deadlines do not work.
+type Interruptible interface {
+	Interrupt() error
+}
+
+type readDeadlineSetter interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// interruptRead aborts a src's in-flight Read when ctx is cancelled,
+// preferring Interruptible, then SetReadDeadline, then Close.
+func interruptRead(src io.Reader) {
+	if ir, ok := src.(Interruptible); ok {
+		ir.Interrupt()
+		return
+	}
+	if ds, ok := src.(readDeadlineSetter); ok {
+		ds.SetReadDeadline(aLongTimeAgo)
+		return
+	}
+	if c, ok := src.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// watchInterrupt spawns a goroutine that calls interruptRead(src) as
+// soon as ctx is done, so a Read blocked on src is unblocked promptly
+// instead of only being noticed between reads. The returned func must
+// be called to stop the goroutine once the link is done with src.
+func watchInterrupt(ctx context.Context, src io.Reader) (stop func()) {
+	if ctx == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			interruptRead(src)
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
 // OneWayLink is the shortcut to OneWayLinkSpec without buffer
 func OneWayLink(ctx context.Context, src io.Reader, dst io.Writer, cb callbackFunc) (int64, error) {
 	return OneWayLinkSpec(ctx, src, dst, nil, cb)
@@ -19,20 +73,21 @@ func OneWayLink(ctx context.Context, src io.Reader, dst io.Writer, cb callbackFu
 // OneWayLinkSpec maintains a one-way link from src to dst
 // until either EOF is reached on src or an error occurs.
 // It returns the number of bytes transferred and the first
-// error encountered, if any.
+// error encountered, if any. If ctx is cancelled, any Read
+// blocked on src is interrupted (see Interruptible) and the
+// returned error is ctx.Err().
 func OneWayLinkSpec(ctx context.Context, src io.Reader, dst io.Writer, buf []byte, cb callbackFunc) (written int64, err error) {
 	if buf == nil {
 		buf = make([]byte, defaultBufferSize)
 	}
+	stop := watchInterrupt(ctx, src)
+	defer stop()
 	for {
-		rn, er := src.Read(buf)
-		if ctx != nil {
-			select {
-			case <-ctx.Done():
-				break
-			default:
-			}
+		if ctx != nil && ctx.Err() != nil {
+			err = ctx.Err()
+			break
 		}
+		rn, er := src.Read(buf)
 		if rn > 0 {
 			tbuf := buf[:rn]
 			if cb != nil {
@@ -54,6 +109,12 @@ func OneWayLinkSpec(ctx context.Context, src io.Reader, dst io.Writer, buf []byt
 		if er != nil {
 			if er != io.EOF {
 				err = er
+				if ctx != nil && ctx.Err() != nil {
+					// er is most likely the side effect of
+					// watchInterrupt aborting this Read (a timeout
+					// or closed-pipe error), not the real failure.
+					err = ctx.Err()
+				}
 			}
 			break
 		}
@@ -69,25 +130,12 @@ func TwoWayLink(ctx context.Context, h1, h2 io.ReadWriteCloser, cb1, cb2 callbac
 // TwoWayLinkSpec maintains a two-way link between X and Y.
 // The end of one link will shut down the entire link. It
 // returns the number of bytes that h1 and h2 write to each
-// other and the first error encountered, if any.
+// other and the first error encountered, if any. It wraps
+// TwoWayLinkResult for backward compatibility.
 func TwoWayLinkSpec(ctx context.Context, h1, h2 io.ReadWriteCloser, buf1, buf2 []byte, cb1, cb2 callbackFunc) (w1, w2 int64, e1, e2 error) {
-	var err error
-	exit := make(chan struct{}, 0)
-	go func() {
-		w1, err = OneWayLinkSpec(ctx, h1, h2, buf1, cb1)
-		if err != nil {
-			e1 = err
-		}
-		h1.Close()
-		h2.Close()
-		close(exit)
-	}()
-	w2, err = OneWayLinkSpec(ctx, h2, h1, buf2, cb2)
-	if err != nil {
-		e2 = err
-	}
-	h2.Close()
-	h1.Close()
-	<-exit
-	return
+	res := TwoWayLinkResult(ctx, h1, h2,
+		OneWayLinkOptions{Buffer: buf1, Callback: cb1},
+		OneWayLinkOptions{Buffer: buf2, Callback: cb2},
+	)
+	return res.W1, res.W2, res.E1, res.E2
 }
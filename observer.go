@@ -0,0 +1,118 @@
+package link
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Direction identifies which half of a two-way link a byte flow or
+// error belongs to.
+type Direction int
+
+const (
+	// DirectionForward is the h1 -> h2 direction of a TwoWayLink.
+	DirectionForward Direction = iota
+	// DirectionReverse is the h2 -> h1 direction of a TwoWayLink.
+	DirectionReverse
+)
+
+// Observer is notified of link activity. Attach one via
+// OneWayLinkOptions.Observer to get read/write/error/close
+// notifications without forking the package to add logging or
+// metrics. Implementations must be safe for concurrent use if shared
+// across both halves of a two-way link.
+type Observer interface {
+	OnRead(n int)
+	OnWrite(n int)
+	OnError(err error, dir Direction)
+	OnClose(written int64, dur time.Duration)
+}
+
+// Stats is a snapshot of an EWMAObserver.
+type Stats struct {
+	BytesPerSec float64
+	TotalBytes  int64
+	LastError   error
+}
+
+// EWMAObserver is a default Observer that tracks a rolling
+// exponentially-weighted moving average of write throughput plus the
+// cumulative bytes written and the last error seen. Attach one
+// instance per direction (one per OneWayLinkOptions) to get
+// independent per-direction throughput.
+type EWMAObserver struct {
+	alpha float64
+
+	mu       sync.Mutex
+	rate     float64
+	total    int64
+	lastErr  error
+	lastTime time.Time
+}
+
+// NewEWMAObserver creates an EWMAObserver with the given smoothing
+// factor in (0, 1]; higher weighs recent samples more heavily.
+// Defaults to 0.2 if alpha is out of range.
+func NewEWMAObserver(alpha float64) *EWMAObserver {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.2
+	}
+	return &EWMAObserver{alpha: alpha}
+}
+
+// OnRead is a no-op; throughput is measured from OnWrite, the point
+// at which bytes have actually been delivered to dst.
+func (o *EWMAObserver) OnRead(n int) {}
+
+// OnWrite folds n bytes into the rolling throughput average and the
+// running total.
+func (o *EWMAObserver) OnWrite(n int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	if !o.lastTime.IsZero() {
+		if dt := now.Sub(o.lastTime).Seconds(); dt > 0 {
+			sample := float64(n) / dt
+			o.rate = o.alpha*sample + (1-o.alpha)*o.rate
+		}
+	}
+	o.lastTime = now
+	o.total += int64(n)
+}
+
+// OnError records err as the last error observed.
+func (o *EWMAObserver) OnError(err error, dir Direction) {
+	o.mu.Lock()
+	o.lastErr = err
+	o.mu.Unlock()
+}
+
+// OnClose is a no-op; final stats are available via Stats.
+func (o *EWMAObserver) OnClose(written int64, dur time.Duration) {}
+
+// Stats returns a snapshot of the observer's current throughput,
+// total bytes, and last error.
+func (o *EWMAObserver) Stats() Stats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return Stats{BytesPerSec: o.rate, TotalBytes: o.total, LastError: o.lastErr}
+}
+
+// LinkResult is the outcome of a TwoWayLinkResult call.
+type LinkResult struct {
+	W1, W2   int64
+	E1, E2   error
+	Duration time.Duration
+}
+
+// TwoWayLinkResult is like TwoWayLinkWithOptions but returns a single
+// LinkResult instead of four separate values, which is easier to
+// plumb through logging or metrics without repacking. TwoWayLinkSpec
+// wraps this for backward compatibility.
+func TwoWayLinkResult(ctx context.Context, h1, h2 io.ReadWriteCloser, opts1, opts2 OneWayLinkOptions) LinkResult {
+	start := time.Now()
+	w1, w2, e1, e2 := TwoWayLinkWithOptions(ctx, h1, h2, opts1, opts2)
+	return LinkResult{W1: w1, W2: w2, E1: e1, E2: e2, Duration: time.Since(start)}
+}
@@ -0,0 +1,206 @@
+package link
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// ProgressEvent reports the outcome of one chunk transferred by
+// ParallelLink.
+type ProgressEvent struct {
+	ChunkIndex int
+	Bytes      int64
+	Err        error
+}
+
+// ParallelOptions configures ParallelLink.
+type ParallelOptions struct {
+	// ChunkSize is the size of each parallel chunk. Defaults to
+	// defaultBufferSize if zero or negative.
+	ChunkSize int64
+	// MaxConcurrency caps the number of chunks in flight at once.
+	// Defaults to 1 if zero or negative.
+	MaxConcurrency int
+	// Margin is the long-tail margin: once len(chunks)-Margin chunks
+	// have completed, every chunk still in flight is redundantly
+	// re-issued to a writer obtained from SecondaryWriter, racing the
+	// original attempt so a single slow worker can't stall the whole
+	// transfer. Ignored if Margin<=0 or SecondaryWriter is nil.
+	Margin int
+	// SecondaryWriter, if set, returns a fresh io.WriterAt for the
+	// redundant long-tail attempt at a chunk. It must be safe to call
+	// concurrently with itself, and it must write to the same
+	// underlying destination as dst (e.g. a second connection to the
+	// same file or the same S3 multipart upload) — ParallelLink races
+	// the two attempts and counts the chunk done as soon as either
+	// one succeeds, so a SecondaryWriter pointing at different
+	// storage than dst will silently leave dst with a hole.
+	SecondaryWriter func() (io.WriterAt, error)
+	// Callback, if set, is applied to each chunk's bytes before they
+	// are written to dst. It must return a slice of the same length:
+	// ParallelLink always writes at the chunk's original offset and
+	// counts its original size as transferred, so a length-changing
+	// Callback would misalign every later WriteAt and miscount the
+	// total returned.
+	Callback callbackFunc
+	// Progress, if non-nil, receives one ProgressEvent per completed
+	// chunk; ParallelLink closes it before returning. The caller must
+	// keep draining it for the duration of the transfer — sends stop
+	// being attempted (and are dropped) only once the transfer has
+	// been cancelled, e.g. by a prior error, so a caller that stops
+	// reading for any other reason will stall the workers still
+	// trying to report.
+	Progress chan<- ProgressEvent
+}
+
+type parallelChunk struct {
+	index int
+	off   int64
+	size  int64
+}
+
+// ParallelLink divides src into chunks of opts.ChunkSize and copies
+// them to dst, transferring up to opts.MaxConcurrency chunks at once.
+// It complements the streaming OneWayLink family for the common case
+// where both ends support random access, e.g. files, S3 parts, or
+// range-capable HTTP. It returns the total bytes transferred and the
+// first error encountered, if any.
+func ParallelLink(ctx context.Context, src io.ReaderAt, size int64, dst io.WriterAt, opts ParallelOptions) (int64, error) {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultBufferSize
+	}
+	concurrency := opts.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	longTail := opts.Margin > 0 && opts.SecondaryWriter != nil
+
+	var chunks []parallelChunk
+	for off, i := int64(0), 0; off < size; off, i = off+chunkSize, i+1 {
+		n := chunkSize
+		if off+n > size {
+			n = size - off
+		}
+		chunks = append(chunks, parallelChunk{index: i, off: off, size: n})
+	}
+
+	if opts.Progress != nil {
+		defer close(opts.Progress)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	transfer := func(c parallelChunk, w io.WriterAt) error {
+		buf := make([]byte, c.size)
+		if _, err := src.ReadAt(buf, c.off); err != nil && err != io.EOF {
+			return err
+		}
+		tbuf := buf
+		if opts.Callback != nil {
+			tbuf = opts.Callback(tbuf)
+		}
+		_, err := w.WriteAt(tbuf, c.off)
+		return err
+	}
+
+	var (
+		sem       = make(chan struct{}, concurrency)
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		written   int64
+		firstErr  error
+		completed int32
+		marginCh  = make(chan struct{})
+		once      sync.Once
+	)
+
+	triggerMargin := func() { once.Do(func() { close(marginCh) }) }
+	if longTail && len(chunks)-opts.Margin <= 0 {
+		triggerMargin()
+	}
+
+	recordErr := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+chunkLoop:
+	for _, c := range chunks {
+		select {
+		case <-ctx.Done():
+			break chunkLoop
+		case sem <- struct{}{}:
+		}
+		c := c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result := make(chan error, 2)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result <- transfer(c, dst)
+			}()
+
+			var err error
+			if longTail {
+				select {
+				case err = <-result:
+				case <-marginCh:
+					attempts := 1
+					if w2, werr := opts.SecondaryWriter(); werr == nil {
+						attempts++
+						wg.Add(1)
+						go func() {
+							defer wg.Done()
+							result <- transfer(c, w2)
+						}()
+					}
+					for i := 0; i < attempts; i++ {
+						if err = <-result; err == nil {
+							break
+						}
+					}
+				}
+			} else {
+				err = <-result
+			}
+
+			if err != nil {
+				recordErr(err)
+			} else {
+				mu.Lock()
+				written += c.size
+				mu.Unlock()
+			}
+
+			if n := atomic.AddInt32(&completed, 1); longTail && int(n) >= len(chunks)-opts.Margin {
+				triggerMargin()
+			}
+			if opts.Progress != nil {
+				select {
+				case opts.Progress <- ProgressEvent{ChunkIndex: c.index, Bytes: c.size, Err: err}:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr == nil {
+		if err := ctx.Err(); err != nil {
+			firstErr = err
+		}
+	}
+	return written, firstErr
+}
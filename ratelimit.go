@@ -0,0 +1,241 @@
+package link
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrExceedsBurst is returned by Rate.Wait when n is larger than the
+// bucket's Burst, since the bucket can never hold enough tokens to
+// satisfy the request and waiting for it would block forever.
+var ErrExceedsBurst = errors.New("link: requested tokens exceed Rate burst")
+
+// ErrInvalidRate is returned by Rate.Wait when BytesPerSec is not
+// positive, since the bucket would then never refill and waiting for
+// it would block forever.
+var ErrInvalidRate = errors.New("link: Rate.BytesPerSec must be positive")
+
+// Rate is a token-bucket limiter: tokens are refilled at BytesPerSec,
+// up to a maximum of Burst, and each transferred byte consumes one
+// token. A single *Rate may be shared across multiple links to cap
+// their aggregate bandwidth, e.g. one bucket per tenant shared by all
+// of that tenant's tunnels.
+type Rate struct {
+	BytesPerSec float64
+	Burst       int64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRate creates a token bucket that refills at bytesPerSec tokens
+// per second up to burst tokens. The bucket starts full.
+func NewRate(bytesPerSec float64, burst int64) *Rate {
+	return &Rate{
+		BytesPerSec: bytesPerSec,
+		Burst:       burst,
+		tokens:      float64(burst),
+		last:        time.Now(),
+	}
+}
+
+// Wait blocks until n tokens are available, consuming them before
+// returning. It returns ErrExceedsBurst if n is greater than Burst,
+// since the bucket would never be able to satisfy the request.
+func (r *Rate) Wait(n int) error {
+	return r.waitContext(nil, n)
+}
+
+// waitContext is like Wait but aborts early with ctx.Err() if ctx is
+// cancelled before enough tokens accumulate.
+func (r *Rate) waitContext(ctx context.Context, n int) error {
+	if int64(n) > r.Burst {
+		return ErrExceedsBurst
+	}
+	if r.BytesPerSec <= 0 {
+		return ErrInvalidRate
+	}
+	for {
+		d, ok := r.reserve(n)
+		if ok {
+			return nil
+		}
+		if ctx == nil {
+			time.Sleep(d)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+		}
+	}
+}
+
+// reserve refills the bucket based on elapsed time and, if n tokens
+// are available, consumes them and returns (0, true). Otherwise it
+// returns the duration to wait before n tokens will be available.
+func (r *Rate) reserve(n int) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.BytesPerSec
+	if r.tokens > float64(r.Burst) {
+		r.tokens = float64(r.Burst)
+	}
+	r.last = now
+
+	if r.tokens >= float64(n) {
+		r.tokens -= float64(n)
+		return 0, true
+	}
+	need := float64(n) - r.tokens
+	return time.Duration(need / r.BytesPerSec * float64(time.Second)), false
+}
+
+// OneWayLinkOptions configures OneWayLinkWithOptions.
+type OneWayLinkOptions struct {
+	// RateLimit, if set, throttles writes to dst to the configured
+	// token-bucket rate. Share one *Rate across links to cap their
+	// combined throughput.
+	RateLimit *Rate
+	// Buffer is the read buffer to reuse; a defaultBufferSize buffer
+	// is allocated if nil.
+	Buffer []byte
+	// Callback is invoked on each chunk read from src before it is
+	// written to dst.
+	Callback callbackFunc
+	// Observer, if set, is notified of reads, writes, errors and the
+	// final close of this link.
+	Observer Observer
+	// Direction is reported to Observer.OnError; it is informational
+	// only and defaults to DirectionForward. TwoWayLinkWithOptions
+	// sets it automatically for each half of the link.
+	Direction Direction
+}
+
+// OneWayLinkWithOptions is like OneWayLinkSpec but accepts an
+// OneWayLinkOptions, allowing a RateLimit and an Observer to be
+// attached. When RateLimit is set, writes larger than its Burst are
+// split so that no single write needs more tokens than the bucket can
+// ever hold.
+func OneWayLinkWithOptions(ctx context.Context, src io.Reader, dst io.Writer, opts OneWayLinkOptions) (written int64, err error) {
+	buf := opts.Buffer
+	if buf == nil {
+		buf = make([]byte, defaultBufferSize)
+	}
+	start := time.Now()
+	if opts.Observer != nil {
+		defer func() { opts.Observer.OnClose(written, time.Since(start)) }()
+	}
+	stop := watchInterrupt(ctx, src)
+	defer stop()
+	for {
+		if ctx != nil && ctx.Err() != nil {
+			err = ctx.Err()
+			break
+		}
+		rn, er := src.Read(buf)
+		if rn > 0 {
+			if opts.Observer != nil {
+				opts.Observer.OnRead(rn)
+			}
+			tbuf := buf[:rn]
+			if opts.Callback != nil {
+				tbuf = opts.Callback(tbuf)
+			}
+			wn, ew := writeThrottled(ctx, dst, tbuf, opts.RateLimit)
+			written += int64(wn)
+			if opts.Observer != nil && wn > 0 {
+				opts.Observer.OnWrite(wn)
+			}
+			if ew != nil {
+				err = ew
+				break
+			}
+		}
+		if er != nil {
+			if er != io.EOF {
+				err = er
+				if ctx != nil && ctx.Err() != nil {
+					// er is most likely the side effect of
+					// watchInterrupt aborting this Read (a timeout
+					// or closed-pipe error), not the real failure.
+					err = ctx.Err()
+				}
+			}
+			break
+		}
+	}
+	if err != nil && opts.Observer != nil {
+		opts.Observer.OnError(err, opts.Direction)
+	}
+	return written, err
+}
+
+// writeThrottled writes tbuf to dst, splitting it into limiter-sized
+// pieces and waiting for tokens before each piece when limiter is set.
+func writeThrottled(ctx context.Context, dst io.Writer, tbuf []byte, limiter *Rate) (int, error) {
+	if limiter == nil {
+		wn, ew := dst.Write(tbuf)
+		if ew == nil && wn != len(tbuf) {
+			ew = io.ErrShortWrite
+		}
+		return wn, ew
+	}
+	var written int
+	for len(tbuf) > 0 {
+		n := len(tbuf)
+		if int64(n) > limiter.Burst {
+			n = int(limiter.Burst)
+		}
+		if err := limiter.waitContext(ctx, n); err != nil {
+			return written, err
+		}
+		wn, ew := dst.Write(tbuf[:n])
+		written += wn
+		if ew != nil {
+			return written, ew
+		}
+		if wn != n {
+			return written, io.ErrShortWrite
+		}
+		tbuf = tbuf[n:]
+	}
+	return written, nil
+}
+
+// TwoWayLinkWithOptions is like TwoWayLinkSpec but takes an
+// OneWayLinkOptions per direction, so each direction can carry its own
+// RateLimit and Observer (or share the same *Rate/Observer to cap or
+// watch the link as a whole). opts1.Direction and opts2.Direction are
+// set to DirectionForward and DirectionReverse respectively.
+func TwoWayLinkWithOptions(ctx context.Context, h1, h2 io.ReadWriteCloser, opts1, opts2 OneWayLinkOptions) (w1, w2 int64, e1, e2 error) {
+	opts1.Direction = DirectionForward
+	opts2.Direction = DirectionReverse
+	exit := make(chan struct{}, 0)
+	go func() {
+		var err error
+		w1, err = OneWayLinkWithOptions(ctx, h1, h2, opts1)
+		if err != nil {
+			e1 = err
+		}
+		h1.Close()
+		h2.Close()
+		close(exit)
+	}()
+	var err error
+	w2, err = OneWayLinkWithOptions(ctx, h2, h1, opts2)
+	if err != nil {
+		e2 = err
+	}
+	h2.Close()
+	h1.Close()
+	<-exit
+	return
+}